@@ -0,0 +1,277 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	awskms "github.com/aws/aws-sdk-go/service/kms"
+	vault "github.com/hashicorp/vault/api"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// Decryptor decrypts envelope-encrypted APIConfig field values for one
+// algorithm tag (the value of model.EncryptedValue.Algorithm).
+type Decryptor interface {
+	// Algorithm returns the tag this Decryptor handles, e.g. "gcpkms".
+	Algorithm() string
+	// Decrypt returns the plaintext for ciphertext under keyID.
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+var (
+	decryptorsMu sync.RWMutex
+	decryptors   = map[string]Decryptor{}
+)
+
+// RegisterDecryptor makes d available under d.Algorithm() for decrypting
+// model.EncryptedValue rows, replacing any previously registered
+// Decryptor for that algorithm tag.
+func RegisterDecryptor(d Decryptor) {
+	decryptorsMu.Lock()
+	defer decryptorsMu.Unlock()
+	decryptors[d.Algorithm()] = d
+}
+
+func decryptorFor(algorithm string) (Decryptor, bool) {
+	decryptorsMu.RLock()
+	defer decryptorsMu.RUnlock()
+	d, ok := decryptors[algorithm]
+	return d, ok
+}
+
+// ListSupportedEncryptAlgorithms returns the algorithm tags with a
+// registered Decryptor, sorted for stable display in admin tooling.
+func ListSupportedEncryptAlgorithms() []string {
+	decryptorsMu.RLock()
+	defer decryptorsMu.RUnlock()
+	algs := make([]string, 0, len(decryptors))
+	for alg := range decryptors {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// GoogleKMSDecryptor decrypts values via Google Cloud KMS. keyID is the
+// full CryptoKey resource name.
+type GoogleKMSDecryptor struct {
+	client *kms.KeyManagementClient
+}
+
+// NewGoogleKMSDecryptor returns a Decryptor backed by Cloud KMS.
+func NewGoogleKMSDecryptor(ctx context.Context) (*GoogleKMSDecryptor, error) {
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("kms.NewKeyManagementClient: %w", err)
+	}
+	return &GoogleKMSDecryptor{client: client}, nil
+}
+
+// Algorithm implements Decryptor.
+func (d *GoogleKMSDecryptor) Algorithm() string { return "gcpkms" }
+
+// Decrypt implements Decryptor.
+func (d *GoogleKMSDecryptor) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	resp, err := d.client.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:       keyID,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms Decrypt: %w", err)
+	}
+	return resp.Plaintext, nil
+}
+
+// AWSKMSDecryptor decrypts values via AWS KMS. keyID is the key ARN or
+// alias used to encrypt the value (AWS KMS can also infer it from the
+// ciphertext blob, but we pass it for clarity and to support key rotation
+// across aliases).
+type AWSKMSDecryptor struct {
+	client *awskms.KMS
+}
+
+// NewAWSKMSDecryptor returns a Decryptor backed by AWS KMS.
+func NewAWSKMSDecryptor(client *awskms.KMS) *AWSKMSDecryptor {
+	return &AWSKMSDecryptor{client: client}
+}
+
+// Algorithm implements Decryptor.
+func (d *AWSKMSDecryptor) Algorithm() string { return "awskms" }
+
+// Decrypt implements Decryptor.
+func (d *AWSKMSDecryptor) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	out, err := d.client.DecryptWithContext(ctx, &awskms.DecryptInput{
+		KeyId:          &keyID,
+		CiphertextBlob: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms.Decrypt: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+// VaultTransitDecryptor decrypts values via HashiCorp Vault's transit
+// secrets engine. keyID is the transit key name.
+type VaultTransitDecryptor struct {
+	client    *vault.Client
+	mountPath string // e.g. "transit"
+}
+
+// NewVaultTransitDecryptor returns a Decryptor backed by Vault transit.
+func NewVaultTransitDecryptor(client *vault.Client, mountPath string) *VaultTransitDecryptor {
+	return &VaultTransitDecryptor{client: client, mountPath: mountPath}
+}
+
+// Algorithm implements Decryptor.
+func (d *VaultTransitDecryptor) Algorithm() string { return "vaulttransit" }
+
+// Decrypt implements Decryptor.
+func (d *VaultTransitDecryptor) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	secret, err := d.client.Logical().WriteWithContext(ctx, fmt.Sprintf("%s/decrypt/%s", d.mountPath, keyID), map[string]interface{}{
+		"ciphertext": string(ciphertext),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("vault transit decrypt: %w", err)
+	}
+	plaintext, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault transit decrypt: response missing plaintext")
+	}
+	return []byte(plaintext), nil
+}
+
+// LocalAESGCMDecryptor decrypts values with an in-process AES-GCM keyring.
+// It exists so tests and local development don't need a real KMS; keys are
+// looked up by keyID from a map supplied at construction time.
+type LocalAESGCMDecryptor struct {
+	keys map[string][]byte // keyID -> 16/24/32-byte AES key
+}
+
+// NewLocalAESGCMDecryptor returns a Decryptor backed by the given keyring.
+func NewLocalAESGCMDecryptor(keys map[string][]byte) *LocalAESGCMDecryptor {
+	return &LocalAESGCMDecryptor{keys: keys}
+}
+
+// Algorithm implements Decryptor.
+func (d *LocalAESGCMDecryptor) Algorithm() string { return "local-aesgcm" }
+
+// Decrypt implements Decryptor. ciphertext is expected to be
+// nonce||sealed, as produced by cipher.AEAD.Seal with a nil destination.
+func (d *LocalAESGCMDecryptor) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	key, ok := d.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("local-aesgcm: unknown key id %v", keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %w", err)
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("local-aesgcm: ciphertext shorter than nonce")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gcm.Open: %w", err)
+	}
+	return plaintext, nil
+}
+
+// DecryptField returns the plaintext of appPkg's encrypted field, decrypting
+// it via the Decryptor registered for its algorithm tag and caching the
+// result for plaintextCacheTTL so repeated access doesn't round-trip to the
+// KMS on every request.
+func (p *Provider) DecryptField(ctx context.Context, appPkg, field string) ([]byte, error) {
+	p.reloadIfExpired(ctx)
+
+	cfg, ok := p.appConfig(appPkg)
+	if !ok {
+		return nil, fmt.Errorf("no config for app %v", appPkg)
+	}
+	ev, ok := cfg.EncryptedFields[field]
+	if !ok {
+		return nil, fmt.Errorf("app %v has no encrypted field %v", appPkg, field)
+	}
+
+	cacheKey := fmt.Sprintf("%s/%s/v%d", appPkg, field, cfg.Version)
+
+	p.ptMu.RLock()
+	if entry, ok := p.plaintextCache[cacheKey]; ok && time.Now().Before(entry.expiresAt) {
+		p.ptMu.RUnlock()
+		return entry.value, nil
+	}
+	p.ptMu.RUnlock()
+
+	dec, ok := decryptorFor(ev.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("no decryptor registered for algorithm %v", ev.Algorithm)
+	}
+	plaintext, err := dec.Decrypt(ctx, ev.KeyID, ev.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %v/%v: %w", appPkg, field, err)
+	}
+
+	p.ptMu.Lock()
+	p.plaintextCache[cacheKey] = plaintextEntry{value: plaintext, expiresAt: time.Now().Add(plaintextCacheTTL)}
+	p.ptMu.Unlock()
+
+	return plaintext, nil
+}
+
+// sweepPlaintextCache periodically deletes expired plaintextCache entries.
+// Without it, one entry accumulates per (appPkg, field, version) ever
+// decrypted and is never reclaimed, since lookups only skip stale entries
+// rather than removing them — an unbounded leak on a long-running process,
+// especially since the version component of the cache key changes on every
+// write to the row, not just ones that touch the encrypted field. It runs
+// until ctx is done.
+func (p *Provider) sweepPlaintextCache(ctx context.Context) {
+	ticker := time.NewTicker(plaintextCacheTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.evictExpiredPlaintext(now)
+		}
+	}
+}
+
+// evictExpiredPlaintext deletes every plaintextCache entry expired as of
+// now. Split out from sweepPlaintextCache so it can be exercised directly
+// in tests without waiting on the real ticker.
+func (p *Provider) evictExpiredPlaintext(now time.Time) {
+	p.ptMu.Lock()
+	defer p.ptMu.Unlock()
+	for key, entry := range p.plaintextCache {
+		if now.After(entry.expiresAt) {
+			delete(p.plaintextCache, key)
+		}
+	}
+}
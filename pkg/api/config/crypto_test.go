@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"cambio/pkg/model"
+)
+
+func init() {
+	// Always available so tests can register fake keys without touching a
+	// real KMS; registering it here (rather than in crypto.go) keeps
+	// "local-aesgcm" out of ListSupportedEncryptAlgorithms in production.
+	RegisterDecryptor(NewLocalAESGCMDecryptor(map[string][]byte{}))
+}
+
+func seal(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatalf("rand.Read nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil)
+}
+
+func TestLocalAESGCMDecryptor_RoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read key: %v", err)
+	}
+	plaintext := []byte("hmac-secret-value")
+	ciphertext := seal(t, key, plaintext)
+
+	dec := NewLocalAESGCMDecryptor(map[string][]byte{"key1": key})
+	got, err := dec.Decrypt(context.Background(), "key1", ciphertext)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != string(plaintext) {
+		t.Fatalf("Decrypt = %q, want %q", got, plaintext)
+	}
+}
+
+func TestLocalAESGCMDecryptor_RejectsTamperedCiphertext(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read key: %v", err)
+	}
+	ciphertext := seal(t, key, []byte("hmac-secret-value"))
+	ciphertext[len(ciphertext)-1] ^= 0xFF // corrupt the GCM auth tag
+
+	dec := NewLocalAESGCMDecryptor(map[string][]byte{"key1": key})
+	if _, err := dec.Decrypt(context.Background(), "key1", ciphertext); err == nil {
+		t.Fatalf("expected tampered ciphertext to be rejected")
+	}
+}
+
+func TestLocalAESGCMDecryptor_UnknownKeyID(t *testing.T) {
+	dec := NewLocalAESGCMDecryptor(map[string][]byte{})
+	if _, err := dec.Decrypt(context.Background(), "missing", []byte("anything")); err == nil {
+		t.Fatalf("expected an unknown key id to error")
+	}
+}
+
+func TestProvider_DecryptField_CachesPlaintext(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read key: %v", err)
+	}
+	plaintext := []byte("secret-value")
+	ciphertext := seal(t, key, plaintext)
+
+	RegisterDecryptor(NewLocalAESGCMDecryptor(map[string][]byte{"key1": key}))
+
+	hist := &appConfigHistory{}
+	hist.add(&model.APIConfig{
+		AppPackageName: "app",
+		Version:        1,
+		EncryptedFields: map[string]*model.EncryptedValue{
+			"hmacSecret": {Algorithm: "local-aesgcm", KeyID: "key1", Ciphertext: ciphertext},
+		},
+	})
+
+	clock := newFakeClock(time.Now())
+	p := newTestProvider(&fakeStore{}, clock)
+	// Mark the Provider as freshly loaded so DecryptField doesn't reload from
+	// the empty fakeStore and replace the cache set up here.
+	p.hasLoadedOnce = true
+	p.lastLoadTime = clock.Now()
+	p.cache["app"] = hist
+
+	got, err := p.DecryptField(context.Background(), "app", "hmacSecret")
+	if err != nil {
+		t.Fatalf("DecryptField: %v", err)
+	}
+	if string(got) != string(plaintext) {
+		t.Fatalf("DecryptField = %q, want %q", got, plaintext)
+	}
+	if len(p.plaintextCache) != 1 {
+		t.Fatalf("expected one cached plaintext entry, got %d", len(p.plaintextCache))
+	}
+}
+
+func TestProvider_EvictExpiredPlaintext(t *testing.T) {
+	p := newTestProvider(&fakeStore{}, newFakeClock(time.Now()))
+
+	p.plaintextCache["expired"] = plaintextEntry{value: []byte("a"), expiresAt: time.Now().Add(-time.Minute)}
+	p.plaintextCache["fresh"] = plaintextEntry{value: []byte("b"), expiresAt: time.Now().Add(time.Minute)}
+
+	p.evictExpiredPlaintext(time.Now())
+
+	if _, ok := p.plaintextCache["expired"]; ok {
+		t.Fatalf("expired entry should have been evicted")
+	}
+	if _, ok := p.plaintextCache["fresh"]; !ok {
+		t.Fatalf("fresh entry should not have been evicted")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cambio/pkg/model"
+)
+
+// This file is a thin backward-compatible facade over a lazily
+// constructed default Provider, kept while callers migrate to holding
+// their own *Provider (via New) instead of relying on package-level
+// functions. New code should prefer New and thread the Provider through
+// explicitly; these functions may be removed once callers have migrated.
+
+var (
+	defaultOnce     sync.Once
+	defaultProvider *Provider
+)
+
+// Default returns the process-wide Provider the package-level functions in
+// this file delegate to, constructing it on first use.
+func Default() *Provider {
+	defaultOnce.Do(func() {
+		p, err := New(context.Background())
+		if err != nil {
+			// New always returns a nil error, so this does not happen in
+			// practice.
+			panic(fmt.Sprintf("config.Default: %v", err))
+		}
+		defaultProvider = p
+	})
+	return defaultProvider
+}
+
+// AppPkgConfig is a facade over Default().AppPkgConfig.
+func AppPkgConfig(ctx context.Context, appPkg string) (*model.APIConfig, error) {
+	return Default().AppPkgConfig(ctx, appPkg)
+}
+
+// AppPkgConfigAtVersion is a facade over Default().AppPkgConfigAtVersion.
+func AppPkgConfigAtVersion(ctx context.Context, appPkg string, version uint64) (*model.APIConfig, error) {
+	return Default().AppPkgConfigAtVersion(ctx, appPkg, version)
+}
+
+// AppPkgConfigForDevice is a facade over Default().AppPkgConfigForDevice.
+func AppPkgConfigForDevice(ctx context.Context, appPkg string, deviceHash uint32) (*model.APIConfig, error) {
+	return Default().AppPkgConfigForDevice(ctx, appPkg, deviceHash)
+}
+
+// PromoteVersion is a facade over Default().PromoteVersion.
+func PromoteVersion(ctx context.Context, appPkg string, version uint64) error {
+	return Default().PromoteVersion(ctx, appPkg, version)
+}
+
+// RollbackVersion is a facade over Default().RollbackVersion.
+func RollbackVersion(ctx context.Context, appPkg string) error {
+	return Default().RollbackVersion(ctx, appPkg)
+}
+
+// SetCanaryPercent is a facade over Default().SetCanaryPercent.
+func SetCanaryPercent(ctx context.Context, appPkg string, percent int) error {
+	return Default().SetCanaryPercent(ctx, appPkg, percent)
+}
+
+// DecryptField is a facade over Default().DecryptField.
+func DecryptField(ctx context.Context, appPkg, field string) ([]byte, error) {
+	return Default().DecryptField(ctx, appPkg, field)
+}
+
+// LastLoadError is a facade over Default().LastLoadError.
+func LastLoadError() error {
+	return Default().LastLoadError()
+}
+
+// Invalidate is a facade over Default().Invalidate.
+func Invalidate(appPkg string) {
+	Default().Invalidate(appPkg)
+}
+
+// RefreshNow is a facade over Default().RefreshNow.
+func RefreshNow(ctx context.Context) error {
+	return Default().RefreshNow(ctx)
+}
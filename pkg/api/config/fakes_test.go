@@ -0,0 +1,108 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cambio/pkg/model"
+)
+
+// fakeLogger discards everything logged, so tests don't depend on the real
+// logging package.
+type fakeLogger struct{}
+
+func (fakeLogger) Info(args ...interface{})                  {}
+func (fakeLogger) Warn(args ...interface{})                  {}
+func (fakeLogger) Errorf(format string, args ...interface{}) {}
+func (fakeLogger) Fatalf(format string, args ...interface{}) {}
+
+// fakeClock lets tests control refreshPeriod expiry deterministically
+// instead of sleeping.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(start time.Time) *fakeClock {
+	return &fakeClock{now: start}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeStore returns a fixed set of configs (or err, if set) and counts how
+// many times it was called, so tests can assert on single-flight coalescing
+// of concurrent reloads.
+type fakeStore struct {
+	mu      sync.Mutex
+	configs []*model.APIConfig
+	err     error
+	delay   time.Duration
+	calls   int
+}
+
+func (s *fakeStore) ReadAPIConfigs(ctx context.Context) ([]*model.APIConfig, error) {
+	s.mu.Lock()
+	s.calls++
+	delay := s.delay
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.configs, nil
+}
+
+func (s *fakeStore) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// newTestProvider builds a Provider directly (bypassing New, which talks to
+// the environment for a Watcher and the real logging package) wired up with
+// fakes suitable for unit tests.
+func newTestProvider(store *fakeStore, clock Clock) *Provider {
+	return &Provider{
+		cache:          make(map[string]*appConfigHistory),
+		plaintextCache: make(map[string]plaintextEntry),
+		refreshPeriod:  time.Minute,
+		clock:          clock,
+		logger:         fakeLogger{},
+		store:          store,
+	}
+}
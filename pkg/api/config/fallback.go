@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/storage"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+
+	"cambio/pkg/model"
+)
+
+// snapshot is the payload a Fallback persists: the full set of APIConfig
+// rows as of the last successful Store read, plus when that read happened.
+type snapshot struct {
+	SavedAt time.Time          `json:"savedAt"`
+	Configs []*model.APIConfig `json:"configs"`
+}
+
+// signedSnapshot wraps a marshaled snapshot with an optional Ed25519
+// signature, so a Fallback can detect a snapshot that was corrupted or
+// tampered with at rest.
+type signedSnapshot struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+func marshalSnapshot(configs []*model.APIConfig, signer ed25519.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(snapshot{SavedAt: time.Now(), Configs: configs})
+	if err != nil {
+		return nil, fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	ss := signedSnapshot{Payload: payload}
+	if signer != nil {
+		ss.Signature = ed25519.Sign(signer, payload)
+	}
+	return json.Marshal(ss)
+}
+
+func unmarshalSnapshot(data []byte, verifier ed25519.PublicKey) ([]*model.APIConfig, error) {
+	var ss signedSnapshot
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return nil, fmt.Errorf("unmarshal signed snapshot: %w", err)
+	}
+	if verifier != nil {
+		if len(ss.Signature) == 0 || !ed25519.Verify(verifier, ss.Payload, ss.Signature) {
+			return nil, fmt.Errorf("snapshot signature verification failed")
+		}
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(ss.Payload, &snap); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot payload: %w", err)
+	}
+	return snap.Configs, nil
+}
+
+// FileFallback persists the fallback snapshot to a local file, for
+// single-instance deployments or as a last resort alongside GCS/Secret
+// Manager fallbacks.
+type FileFallback struct {
+	path     string
+	signer   ed25519.PrivateKey
+	verifier ed25519.PublicKey
+}
+
+// NewFileFallback returns a Fallback backed by the file at path. signer and
+// verifier may be nil to skip signing/verification.
+func NewFileFallback(path string, signer ed25519.PrivateKey, verifier ed25519.PublicKey) *FileFallback {
+	return &FileFallback{path: path, signer: signer, verifier: verifier}
+}
+
+// Save implements Fallback, writing atomically via a temp file + rename so
+// a crash mid-write can't leave a truncated snapshot on disk.
+func (f *FileFallback) Save(ctx context.Context, configs []*model.APIConfig) error {
+	data, err := marshalSnapshot(configs, f.signer)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp snapshot file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp snapshot file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("rename temp snapshot file into place: %w", err)
+	}
+	return nil
+}
+
+// Load implements Fallback.
+func (f *FileFallback) Load(ctx context.Context) ([]*model.APIConfig, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot file: %w", err)
+	}
+	return unmarshalSnapshot(data, f.verifier)
+}
+
+// GCSFallback persists the fallback snapshot as a GCS object.
+type GCSFallback struct {
+	client   *storage.Client
+	bucket   string
+	object   string
+	signer   ed25519.PrivateKey
+	verifier ed25519.PublicKey
+}
+
+// NewGCSFallback returns a Fallback backed by gs://bucket/object.
+func NewGCSFallback(client *storage.Client, bucket, object string, signer ed25519.PrivateKey, verifier ed25519.PublicKey) *GCSFallback {
+	return &GCSFallback{client: client, bucket: bucket, object: object, signer: signer, verifier: verifier}
+}
+
+// Save implements Fallback.
+func (f *GCSFallback) Save(ctx context.Context, configs []*model.APIConfig) error {
+	data, err := marshalSnapshot(configs, f.signer)
+	if err != nil {
+		return err
+	}
+
+	w := f.client.Bucket(f.bucket).Object(f.object).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("write gcs snapshot object: %w", err)
+	}
+	return w.Close()
+}
+
+// Load implements Fallback.
+func (f *GCSFallback) Load(ctx context.Context) ([]*model.APIConfig, error) {
+	r, err := f.client.Bucket(f.bucket).Object(f.object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open gcs snapshot object: %w", err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read gcs snapshot object: %w", err)
+	}
+	return unmarshalSnapshot(data, f.verifier)
+}
+
+// SecretManagerFallback persists the fallback snapshot as a new version of
+// a Secret Manager secret.
+type SecretManagerFallback struct {
+	client   *secretmanager.Client
+	secret   string // full resource name, e.g. "projects/p/secrets/apiconfig-fallback"
+	signer   ed25519.PrivateKey
+	verifier ed25519.PublicKey
+}
+
+// NewSecretManagerFallback returns a Fallback backed by new versions of the
+// given Secret Manager secret.
+func NewSecretManagerFallback(client *secretmanager.Client, secret string, signer ed25519.PrivateKey, verifier ed25519.PublicKey) *SecretManagerFallback {
+	return &SecretManagerFallback{client: client, secret: secret, signer: signer, verifier: verifier}
+}
+
+// Save implements Fallback, adding a new secret version rather than
+// overwriting one, so Secret Manager's own version history doubles as an
+// audit trail of past snapshots.
+func (f *SecretManagerFallback) Save(ctx context.Context, configs []*model.APIConfig) error {
+	data, err := marshalSnapshot(configs, f.signer)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+		Parent:  f.secret,
+		Payload: &secretmanagerpb.SecretPayload{Data: data},
+	})
+	if err != nil {
+		return fmt.Errorf("add secret version: %w", err)
+	}
+	return nil
+}
+
+// Load implements Fallback, reading the latest secret version.
+func (f *SecretManagerFallback) Load(ctx context.Context) ([]*model.APIConfig, error) {
+	resp, err := f.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: f.secret + "/versions/latest",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("access secret version: %w", err)
+	}
+	return unmarshalSnapshot(resp.Payload.Data, f.verifier)
+}
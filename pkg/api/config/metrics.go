@@ -0,0 +1,46 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// reloadResult labels the result dimension of configReloadTotal.
+type reloadResult string
+
+const (
+	reloadResultSuccess  reloadResult = "success"
+	reloadResultFallback reloadResult = "fallback"
+	reloadResultError    reloadResult = "error"
+)
+
+var (
+	configReloadTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "config_reload_total",
+		Help: "Count of APIConfig reload attempts, by result (success, fallback, error).",
+	}, []string{"result"})
+
+	configAgeSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "config_age_seconds",
+		Help: "Seconds since APIConfig data was last read successfully from the store, as of the most recent reload attempt.",
+	})
+
+	configCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "config_cache_entries",
+		Help: "Number of AppPackageName entries currently cached.",
+	})
+)
@@ -0,0 +1,57 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "time"
+
+// Option configures a Provider constructed via New.
+type Option func(*Provider)
+
+// WithRefreshPeriod overrides how often a Provider reloads from its Store
+// when no Watcher invalidation has arrived. The default is one minute.
+func WithRefreshPeriod(d time.Duration) Option {
+	return func(p *Provider) { p.refreshPeriod = d }
+}
+
+// WithStore overrides the Store a Provider reads APIConfig rows from. The
+// default reads from the package's configured database.
+func WithStore(s Store) Option {
+	return func(p *Provider) { p.store = s }
+}
+
+// WithWatcher overrides the Watcher a Provider subscribes to for change
+// notifications. The default picks a Watcher from the environment (Cloud
+// Pub/Sub or Postgres LISTEN/NOTIFY), or none if neither is configured.
+func WithWatcher(w Watcher) Option {
+	return func(p *Provider) { p.watcher = w }
+}
+
+// WithLogger overrides the Logger a Provider uses. The default is the
+// logger bound to the context passed to New.
+func WithLogger(l Logger) Option {
+	return func(p *Provider) { p.logger = l }
+}
+
+// WithClock overrides the Clock a Provider uses to evaluate refreshPeriod,
+// letting tests control expiry without sleeping.
+func WithClock(c Clock) Option {
+	return func(p *Provider) { p.clock = c }
+}
+
+// WithFallback supplies a Fallback a Provider can load from when its Store
+// fails, and saves the last good load to as it succeeds.
+func WithFallback(f Fallback) Option {
+	return func(p *Provider) { p.fallback = f }
+}
@@ -0,0 +1,430 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config loads and caches the per-AppPackageName APIConfig rows
+// used to gate the upload and export APIs.
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"cambio/pkg/database"
+	"cambio/pkg/logging"
+	"cambio/pkg/model"
+)
+
+const (
+	defaultRefreshPeriod = time.Minute
+
+	// loadRetryAttempts bounds how many times in all (the first try
+	// included) doReload attempts a Store read, with exponential backoff
+	// between attempts, before falling back to the configured Fallback (or
+	// giving up and keeping the existing cache).
+	loadRetryAttempts = 3
+	// loadRetryBaseDelay is the delay before the first retry; it doubles
+	// after each subsequent attempt.
+	loadRetryBaseDelay = 250 * time.Millisecond
+
+	// maxCachedVersions bounds how many past versions of an APIConfig are
+	// kept in memory per AppPackageName, enough to canary a new version and
+	// still roll back to the one before the previously pinned one.
+	maxCachedVersions = 5
+
+	// plaintextCacheTTL bounds how long a decrypted field value is kept in
+	// memory. It is intentionally shorter than refreshPeriod so decrypted
+	// secrets don't linger long after the config row that references them
+	// has been rotated or revoked.
+	plaintextCacheTTL = 15 * time.Second
+)
+
+// Store abstracts the backing store for APIConfig rows so tests and
+// alternate deployments can swap out database.ReadAPIConfigs.
+type Store interface {
+	ReadAPIConfigs(ctx context.Context) ([]*model.APIConfig, error)
+}
+
+type databaseStore struct{}
+
+func (databaseStore) ReadAPIConfigs(ctx context.Context) ([]*model.APIConfig, error) {
+	return database.ReadAPIConfigs(ctx)
+}
+
+// Logger is the subset of the package logger's behavior Provider depends
+// on; *logging.Logger satisfies it.
+type Logger interface {
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Clock abstracts time so tests can control expiry without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Fallback persists the last successfully loaded set of APIConfigs
+// somewhere durable, and can reload it, so Provider can keep serving
+// requests through a transient Store outage.
+type Fallback interface {
+	Save(ctx context.Context, configs []*model.APIConfig) error
+	Load(ctx context.Context) ([]*model.APIConfig, error)
+}
+
+// Provider loads, caches, and serves APIConfig rows. Construct one with
+// New; the zero value is not usable.
+type Provider struct {
+	mu                   sync.RWMutex
+	lastLoadTime         time.Time // last time the cache was refreshed, from store or fallback
+	lastStoreSuccessTime time.Time // last time the store itself was read successfully
+	hasLoadedOnce        bool      // true once the cache has been populated at least once
+	needsReload          bool      // set by Invalidate/the watcher to force the next reload
+	lastLoadErr          error
+	cache                map[string]*appConfigHistory
+	refreshPeriod        time.Duration
+	watcher              Watcher
+	signingKey           ed25519.PublicKey
+	store                Store
+	logger               Logger
+	clock                Clock
+	fallback             Fallback
+	reloadGroup          singleflight.Group
+
+	ptMu           sync.RWMutex
+	plaintextCache map[string]plaintextEntry
+}
+
+// plaintextEntry is a short-lived cache entry for a decrypted field value.
+type plaintextEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// New creates a Provider, applying opts over the defaults (database-backed
+// Store, the package logger, a real Clock, a one-minute refresh period,
+// and a Watcher chosen from the environment if one isn't supplied via
+// WithWatcher). It starts the watcher subscription, if any, before
+// returning.
+func New(ctx context.Context, opts ...Option) (*Provider, error) {
+	p := &Provider{
+		cache:          make(map[string]*appConfigHistory),
+		refreshPeriod:  defaultRefreshPeriod,
+		plaintextCache: make(map[string]plaintextEntry),
+		store:          databaseStore{},
+		logger:         logging.FromContext(ctx),
+		clock:          realClock{},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if keyHex := os.Getenv("CONFIG_SIGNING_PUBLIC_KEY"); keyHex != "" {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			p.logger.Errorf("CONFIG_SIGNING_PUBLIC_KEY is not a valid hex-encoded ed25519 public key: %v", err)
+		} else {
+			p.signingKey = ed25519.PublicKey(key)
+		}
+	}
+
+	if p.refreshPeriod > time.Minute*5 {
+		p.logger.Warn("config refresh duration is > 5 minutes: %v", p.refreshPeriod)
+	}
+
+	if p.watcher == nil {
+		watcher, err := newWatcher(ctx)
+		if err != nil {
+			// No watcher, no problem: the periodic refresh above still
+			// applies, just with its usual staleness window instead of
+			// near-instant invalidation.
+			p.logger.Errorf("config watcher unavailable, falling back to periodic refresh: %v", err)
+		} else {
+			p.watcher = watcher
+		}
+	}
+	p.watch(ctx)
+	go p.sweepPlaintextCache(ctx)
+
+	return p, nil
+}
+
+// watch subscribes to p.watcher, if configured, and invalidates the cache
+// as soon as a change notification arrives rather than waiting up to
+// refreshPeriod for the next periodic reload.
+func (p *Provider) watch(ctx context.Context) {
+	if p.watcher == nil {
+		return
+	}
+
+	ch, err := p.watcher.Watch(ctx)
+	if err != nil {
+		p.logger.Errorf("unable to start config watcher, falling back to periodic refresh: %v", err)
+		return
+	}
+
+	go func() {
+		for range ch {
+			p.mu.Lock()
+			p.needsReload = true
+			p.mu.Unlock()
+			if err := p.RefreshNow(ctx); err != nil {
+				p.logger.Errorf("error reloading APIConfig after change notification: %v", err)
+			}
+		}
+	}()
+}
+
+// Invalidate marks appPkg's cached config as stale so the next access
+// reloads it, and kicks off that reload in the background — callers never
+// block on it. database.ReadAPIConfigs currently reads the whole APIConfig
+// table in one query, so this forces a full reload rather than evicting a
+// single row, fetching every AppPackageName, appPkg included.
+//
+// needsReload is a dedicated flag rather than zeroing lastLoadTime: the
+// latter is also how reloadIfExpired recognizes a Provider that has never
+// loaded anything (its cold-start path reloads synchronously so the very
+// first caller doesn't race an empty cache). Reusing it here would make
+// every Invalidate look like a cold start to reloadIfExpired — forcing the
+// next caller onto the blocking path, and if that reload then failed,
+// permanently stuck re-triggering a blocking reload on every subsequent
+// call.
+func (p *Provider) Invalidate(appPkg string) {
+	p.mu.Lock()
+	p.needsReload = true
+	p.mu.Unlock()
+
+	go func() {
+		if err := p.RefreshNow(context.Background()); err != nil {
+			p.logger.Errorf("error reloading APIConfig after invalidation of %v: %v", appPkg, err)
+		}
+	}()
+}
+
+// RefreshNow synchronously reloads from the store (or fallback), ignoring
+// refreshPeriod, and returns the error from that attempt. Concurrent
+// RefreshNow/reloadIfExpired calls coalesce into a single underlying read
+// via p.reloadGroup.
+func (p *Provider) RefreshNow(ctx context.Context) error {
+	_, err, _ := p.reloadGroup.Do("reload", func() (interface{}, error) {
+		return nil, p.doReload(ctx)
+	})
+	return err
+}
+
+// reloadIfExpired triggers a reload once refreshPeriod has elapsed since
+// the last one. The very first load blocks so callers don't race an empty
+// cache on a cold Provider; every later refresh runs in the background —
+// callers go on serving the slightly stale cached value from the RLock
+// path in appConfig rather than blocking behind the reload.
+func (p *Provider) reloadIfExpired(ctx context.Context) {
+	p.mu.RLock()
+	coldStart := !p.hasLoadedOnce
+	expired := p.needsReload || p.clock.Now().Sub(p.lastLoadTime) >= p.refreshPeriod
+	p.mu.RUnlock()
+
+	if !expired {
+		return
+	}
+
+	if coldStart {
+		if err := p.RefreshNow(ctx); err != nil {
+			p.logger.Errorf("error loading initial APIConfig: %v", err)
+		}
+		return
+	}
+
+	go func() {
+		if err := p.RefreshNow(ctx); err != nil {
+			p.logger.Errorf("error reloading APIConfig: %v", err)
+		}
+	}()
+}
+
+// doReload reads the APIConfig rows from the store (or, on failure, the
+// configured Fallback) and swaps them into the cache. It does not check
+// refreshPeriod; callers decide when a reload is due.
+func (p *Provider) doReload(ctx context.Context) error {
+	configs, err := p.readWithRetry(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.lastLoadErr = err
+		if !p.lastStoreSuccessTime.IsZero() {
+			configAgeSeconds.Set(time.Since(p.lastStoreSuccessTime).Seconds())
+		}
+		p.mu.Unlock()
+
+		if p.fallback == nil {
+			// Without a valid config we'd otherwise be unable to process
+			// requests, but crashing the process over a transient DB
+			// outage just turns a blip into an incident: keep serving
+			// whatever is already cached instead.
+			p.logger.Errorf("error loading APIConfig, no fallback configured, keeping existing cache: %v", err)
+			configReloadTotal.WithLabelValues(string(reloadResultError)).Inc()
+			return err
+		}
+
+		snapshotConfigs, fbErr := p.fallback.Load(ctx)
+		if fbErr != nil {
+			p.logger.Errorf("error loading APIConfig (%v) and fallback snapshot unavailable (%v), keeping existing cache", err, fbErr)
+			configReloadTotal.WithLabelValues(string(reloadResultError)).Inc()
+			return err
+		}
+
+		p.logger.Warn("serving APIConfig from fallback snapshot after store error: %v", err)
+		p.mu.Lock()
+		p.applyConfigs(snapshotConfigs)
+		p.mu.Unlock()
+		configReloadTotal.WithLabelValues(string(reloadResultFallback)).Inc()
+		return nil
+	}
+
+	p.mu.Lock()
+	p.lastLoadErr = nil
+	p.lastStoreSuccessTime = p.clock.Now()
+	p.applyConfigs(configs)
+	p.mu.Unlock()
+	configReloadTotal.WithLabelValues(string(reloadResultSuccess)).Inc()
+
+	if p.fallback != nil {
+		if err := p.fallback.Save(ctx, configs); err != nil {
+			p.logger.Errorf("unable to persist fallback APIConfig snapshot: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// readWithRetry calls p.store.ReadAPIConfigs up to loadRetryAttempts times
+// in all, with exponential backoff between attempts, before giving up.
+func (p *Provider) readWithRetry(ctx context.Context) ([]*model.APIConfig, error) {
+	delay := loadRetryBaseDelay
+	var err error
+	for attempt := 1; attempt <= loadRetryAttempts; attempt++ {
+		var configs []*model.APIConfig
+		configs, err = p.store.ReadAPIConfigs(ctx)
+		if err == nil {
+			return configs, nil
+		}
+		if attempt == loadRetryAttempts {
+			break
+		}
+		p.logger.Warn("APIConfig read attempt %v/%v failed, retrying in %v: %v", attempt, loadRetryAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return nil, err
+}
+
+// applyConfigs replaces p.cache with configs, verifying signatures and
+// preserving per-AppPackageName pinning/canary state and the history of
+// any row that fails verification. Callers must hold p.mu.
+func (p *Provider) applyConfigs(configs []*model.APIConfig) {
+	next := make(map[string]*appConfigHistory, len(p.cache))
+	for _, apiConfig := range configs {
+		if p.signingKey != nil {
+			if err := apiConfig.Verify(p.signingKey); err != nil {
+				// Refuse the tampered row but keep serving whatever this
+				// AppPackageName last had in cache.
+				p.logger.Errorf("refusing tampered APIConfig row: %v", err)
+				if prev, ok := p.cache[apiConfig.AppPackageName]; ok {
+					next[apiConfig.AppPackageName] = prev
+				}
+				continue
+			}
+		}
+
+		hist, ok := next[apiConfig.AppPackageName]
+		if !ok {
+			if prev, ok := p.cache[apiConfig.AppPackageName]; ok {
+				// Reuse the previous history (not just its pinned/canary
+				// state) so versions accumulates across reloads instead of
+				// being rebuilt from scratch with only the single row this
+				// read returned.
+				hist = prev
+			} else {
+				hist = &appConfigHistory{}
+			}
+			next[apiConfig.AppPackageName] = hist
+		}
+		hist.add(apiConfig)
+	}
+
+	p.cache = next
+	p.lastLoadTime = p.clock.Now()
+	p.hasLoadedOnce = true
+	p.needsReload = false
+	p.logger.Info("loaded new APIConfig values")
+
+	configCacheEntries.Set(float64(len(p.cache)))
+	if !p.lastStoreSuccessTime.IsZero() {
+		configAgeSeconds.Set(time.Since(p.lastStoreSuccessTime).Seconds())
+	}
+}
+
+// LastLoadError returns the Store error from the most recent reload
+// attempt, or nil if that attempt read the store successfully. A reload
+// served from a fallback snapshot still leaves the Store's error here,
+// although RefreshNow returns nil for it. Operators can poll this, alongside the
+// config_reload_total and config_age_seconds metrics, to detect a Provider
+// that has been running on stale or fallback data for too long.
+func (p *Provider) LastLoadError() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastLoadErr
+}
+
+// appConfig returns the config an ordinary (non-canary) caller should see:
+// the pinned version, which is the first version loaded for appPkg until
+// PromoteVersion or RollbackVersion pins another. Newer loaded versions are
+// not served here until one of them is promoted.
+func (p *Provider) appConfig(appPkg string) (*model.APIConfig, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return nil, false
+	}
+	cfg := hist.current()
+	return cfg, cfg != nil
+}
+
+// AppPkgConfig returns the APIConfig for appPkg. If the cache has expired
+// it reloads from the store first only on a cold Provider; otherwise the
+// reload runs in the background and the cached value is returned.
+func (p *Provider) AppPkgConfig(ctx context.Context, appPkg string) (*model.APIConfig, error) {
+	p.reloadIfExpired(ctx)
+
+	appConfig, ok := p.appConfig(appPkg)
+	if !ok {
+		p.logger.Errorf("requested config for unconfigured app: %v", appPkg)
+	}
+
+	return appConfig, nil
+}
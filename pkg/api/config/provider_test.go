@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cambio/pkg/model"
+)
+
+// waitForCallCount polls until store has been called at least n times, or
+// fails the test after timeout.
+func waitForCallCount(t *testing.T, store *fakeStore, n int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if store.callCount() >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("store was not called %d times within %v (got %d)", n, timeout, store.callCount())
+}
+
+func TestReloadIfExpired_ColdStartBlocksUntilLoaded(t *testing.T) {
+	store := &fakeStore{configs: []*model.APIConfig{{AppPackageName: "app", Version: 1}}}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+
+	p.reloadIfExpired(context.Background())
+
+	if store.callCount() != 1 {
+		t.Fatalf("expected exactly one synchronous store read on cold start, got %d", store.callCount())
+	}
+	if _, ok := p.appConfig("app"); !ok {
+		t.Fatalf("expected cache to be populated immediately after cold start")
+	}
+}
+
+func TestReloadIfExpired_WarmRefreshIsAsyncAndCoalesced(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	store := &fakeStore{configs: []*model.APIConfig{{AppPackageName: "app", Version: 1}}, delay: 100 * time.Millisecond}
+	p := newTestProvider(store, clock)
+
+	// Cold start: populates the cache so later calls aren't a cold start.
+	p.reloadIfExpired(context.Background())
+	waitForCallCount(t, store, 1, time.Second)
+
+	clock.Advance(2 * time.Minute) // past refreshPeriod
+
+	start := time.Now()
+	// Several concurrent callers noticing expiry at once should coalesce
+	// into a single in-flight reload and none of them should block on it.
+	for i := 0; i < 5; i++ {
+		p.reloadIfExpired(context.Background())
+	}
+	elapsed := time.Since(start)
+	if elapsed > 50*time.Millisecond {
+		t.Fatalf("reloadIfExpired on a warm cache blocked the caller for %v, want near-instant", elapsed)
+	}
+
+	waitForCallCount(t, store, 2, time.Second)
+	if got := store.callCount(); got != 2 {
+		t.Fatalf("expected the 5 concurrent expirations to coalesce into 1 extra read (2 total), got %d", got)
+	}
+}
+
+// TestInvalidate_DoesNotBlockCaller is a regression test: Invalidate used to
+// reset lastLoadTime to the zero value, which reloadIfExpired also uses to
+// detect a Provider that has never loaded anything. That made every
+// Invalidate call look like a cold start, forcing the caller (and any
+// concurrent AppPkgConfig caller) onto the blocking reload path instead of
+// dispatching the reload in the background.
+func TestInvalidate_DoesNotBlockCaller(t *testing.T) {
+	store := &fakeStore{configs: []*model.APIConfig{{AppPackageName: "app", Version: 1}}, delay: 150 * time.Millisecond}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+
+	// Populate the cache once so the Provider is warm.
+	p.reloadIfExpired(context.Background())
+	waitForCallCount(t, store, 1, time.Second)
+
+	start := time.Now()
+	p.Invalidate("app")
+	elapsed := time.Since(start)
+	if elapsed > 50*time.Millisecond {
+		t.Fatalf("Invalidate blocked its caller for %v, want near-instant", elapsed)
+	}
+
+	waitForCallCount(t, store, 2, time.Second)
+
+	p.mu.RLock()
+	coldStart := !p.hasLoadedOnce
+	p.mu.RUnlock()
+	if coldStart {
+		t.Fatalf("Provider should not look like a cold start after Invalidate")
+	}
+}
+
+func TestInvalidate_RecoversAfterFailedReload(t *testing.T) {
+	store := &fakeStore{err: context.DeadlineExceeded}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+	p.hasLoadedOnce = true // simulate a Provider that had already loaded once
+
+	p.Invalidate("app")
+	waitForCallCount(t, store, 1, time.Second)
+
+	// A failed reload after Invalidate must not leave the Provider wedged
+	// in a state where every subsequent call re-triggers a blocking
+	// synchronous reload.
+	p.mu.RLock()
+	coldStart := !p.hasLoadedOnce
+	p.mu.RUnlock()
+	if coldStart {
+		t.Fatalf("a failed reload after Invalidate should not flip the Provider back to cold-start")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"cambio/pkg/model"
+)
+
+// appConfigHistory tracks the recent versions of an APIConfig for a single
+// AppPackageName, newest first, capped at maxCachedVersions. It lets the
+// Provider serve a pinned version to most traffic while canarying a new
+// version to a percentage of requests, and roll back to an older version
+// on demand.
+type appConfigHistory struct {
+	versions      []*model.APIConfig // newest first
+	pinned        *model.APIConfig   // version served outside of canary; nil means "use newest"
+	canaryPercent int                // 0-100, percent of traffic sent to versions[0]
+}
+
+// add records a newly loaded version, evicting the oldest once the history
+// exceeds maxCachedVersions. A version already in the history is replaced
+// in place rather than added again. If nothing is pinned yet, the first
+// version seen becomes the pinned one so a fresh AppPackageName doesn't
+// start in canary-only mode.
+func (h *appConfigHistory) add(cfg *model.APIConfig) {
+	for i, v := range h.versions {
+		if v.Version == cfg.Version {
+			h.versions[i] = cfg
+			if h.pinned == v {
+				h.pinned = cfg
+			}
+			return
+		}
+	}
+	h.versions = append([]*model.APIConfig{cfg}, h.versions...)
+	if len(h.versions) > maxCachedVersions {
+		h.versions = h.versions[:maxCachedVersions]
+	}
+	if h.pinned == nil {
+		h.pinned = cfg
+	}
+}
+
+// current returns the version non-canary traffic should see.
+func (h *appConfigHistory) current() *model.APIConfig {
+	if h.pinned != nil {
+		return h.pinned
+	}
+	if len(h.versions) > 0 {
+		return h.versions[0]
+	}
+	return nil
+}
+
+// forDevice returns the version a request from a device whose metadata
+// hashes to deviceHash should see, applying the configured canary split.
+func (h *appConfigHistory) forDevice(deviceHash uint32) *model.APIConfig {
+	if h.canaryPercent > 0 && len(h.versions) > 0 && int(deviceHash%100) < h.canaryPercent {
+		return h.versions[0]
+	}
+	return h.current()
+}
+
+func (h *appConfigHistory) atVersion(version uint64) (*model.APIConfig, bool) {
+	for _, v := range h.versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// AppPkgConfigAtVersion returns the cached APIConfig for appPkg at exactly
+// version, bypassing canary/pinning. It does not trigger a reload; the
+// version must already be in the last maxCachedVersions loaded.
+func (p *Provider) AppPkgConfigAtVersion(ctx context.Context, appPkg string, version uint64) (*model.APIConfig, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return nil, fmt.Errorf("no config for app %v", appPkg)
+	}
+	cfg, ok := hist.atVersion(version)
+	if !ok {
+		return nil, fmt.Errorf("app %v has no cached version %v", appPkg, version)
+	}
+	return cfg, nil
+}
+
+// AppPkgConfigForDevice returns the APIConfig appPkg should serve to a
+// request whose device metadata hashes to deviceHash, honoring any
+// in-progress canary rollout.
+func (p *Provider) AppPkgConfigForDevice(ctx context.Context, appPkg string, deviceHash uint32) (*model.APIConfig, error) {
+	p.reloadIfExpired(ctx)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return nil, fmt.Errorf("no config for app %v", appPkg)
+	}
+	return hist.forDevice(deviceHash), nil
+}
+
+// PromoteVersion pins appPkg to version, so it is served to all traffic
+// regardless of which version is newest, and clears any canary in
+// progress. Intended for the admin promote/rollback API.
+func (p *Provider) PromoteVersion(ctx context.Context, appPkg string, version uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return fmt.Errorf("no config for app %v", appPkg)
+	}
+	cfg, ok := hist.atVersion(version)
+	if !ok {
+		return fmt.Errorf("app %v has no cached version %v", appPkg, version)
+	}
+	hist.pinned = cfg
+	hist.canaryPercent = 0
+	return nil
+}
+
+// RollbackVersion pins appPkg to the version immediately prior to the one
+// currently pinned, and clears any canary in progress.
+func (p *Provider) RollbackVersion(ctx context.Context, appPkg string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return fmt.Errorf("no config for app %v", appPkg)
+	}
+
+	idx := -1
+	for i, v := range hist.versions {
+		if hist.pinned != nil && v.Version == hist.pinned.Version {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || idx+1 >= len(hist.versions) {
+		return fmt.Errorf("app %v has no earlier cached version to roll back to", appPkg)
+	}
+
+	hist.pinned = hist.versions[idx+1]
+	hist.canaryPercent = 0
+	return nil
+}
+
+// SetCanaryPercent routes percent of traffic (0-100) to the newest loaded
+// version for appPkg, while the rest continue to see the pinned version.
+func (p *Provider) SetCanaryPercent(ctx context.Context, appPkg string, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary percent must be between 0 and 100, got %v", percent)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hist, ok := p.cache[appPkg]
+	if !ok {
+		return fmt.Errorf("no config for app %v", appPkg)
+	}
+	hist.canaryPercent = percent
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"cambio/pkg/model"
+)
+
+func signedConfig(t *testing.T, priv ed25519.PrivateKey, appPkg string, version uint64) *model.APIConfig {
+	t.Helper()
+	cfg := &model.APIConfig{
+		AppPackageName: appPkg,
+		Version:        version,
+		CreatedAt:      time.Unix(int64(version), 0),
+		CreatedBy:      "test",
+	}
+	if err := cfg.Sign(priv); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return cfg
+}
+
+func TestAppConfigHistory_ForDeviceCanarySplit(t *testing.T) {
+	hist := &appConfigHistory{}
+	v1 := &model.APIConfig{AppPackageName: "app", Version: 1}
+	v2 := &model.APIConfig{AppPackageName: "app", Version: 2}
+	hist.add(v1) // v1 becomes pinned, since nothing was pinned yet
+	hist.add(v2) // v2 becomes the newest (versions[0]); pinned stays v1
+	hist.canaryPercent = 30
+
+	var toCanary, toPinned int
+	for hash := uint32(0); hash < 100; hash++ {
+		got := hist.forDevice(hash)
+		switch got.Version {
+		case 2:
+			toCanary++
+		case 1:
+			toPinned++
+		default:
+			t.Fatalf("forDevice(%d) returned unexpected version %d", hash, got.Version)
+		}
+	}
+	if toCanary != 30 || toPinned != 70 {
+		t.Fatalf("canary split = %d/%d, want 30/70", toCanary, toPinned)
+	}
+}
+
+func TestAppConfigHistory_ForDeviceNoCanary(t *testing.T) {
+	hist := &appConfigHistory{}
+	v1 := &model.APIConfig{AppPackageName: "app", Version: 1}
+	hist.add(v1)
+
+	got := hist.forDevice(0)
+	if got.Version != 1 {
+		t.Fatalf("forDevice with no canary configured = v%d, want v1", got.Version)
+	}
+}
+
+func TestProvider_PromoteAndRollbackVersion(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(&fakeStore{}, newFakeClock(time.Now()))
+
+	hist := &appConfigHistory{}
+	hist.add(&model.APIConfig{AppPackageName: "app", Version: 1})
+	hist.add(&model.APIConfig{AppPackageName: "app", Version: 2})
+	p.cache["app"] = hist
+
+	if err := p.PromoteVersion(ctx, "app", 2); err != nil {
+		t.Fatalf("PromoteVersion: %v", err)
+	}
+	if cfg, ok := p.appConfig("app"); !ok || cfg.Version != 2 {
+		t.Fatalf("after PromoteVersion(2), current = %+v, ok=%v", cfg, ok)
+	}
+
+	if err := p.RollbackVersion(ctx, "app"); err != nil {
+		t.Fatalf("RollbackVersion: %v", err)
+	}
+	if cfg, ok := p.appConfig("app"); !ok || cfg.Version != 1 {
+		t.Fatalf("after RollbackVersion, current = %+v, ok=%v", cfg, ok)
+	}
+
+	if err := p.RollbackVersion(ctx, "app"); err == nil {
+		t.Fatalf("RollbackVersion past the oldest cached version should have failed")
+	}
+}
+
+func TestApplyConfigs_AccumulatesVersionsAcrossReloads(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{configs: []*model.APIConfig{{AppPackageName: "app", Version: 1}}}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+
+	if err := p.doReload(ctx); err != nil {
+		t.Fatalf("doReload (v1): %v", err)
+	}
+
+	store.configs = []*model.APIConfig{{AppPackageName: "app", Version: 2}}
+	if err := p.doReload(ctx); err != nil {
+		t.Fatalf("doReload (v2): %v", err)
+	}
+
+	if _, err := p.AppPkgConfigAtVersion(ctx, "app", 1); err != nil {
+		t.Fatalf("AppPkgConfigAtVersion(1) should still be cached after a second reload: %v", err)
+	}
+
+	if err := p.PromoteVersion(ctx, "app", 2); err != nil {
+		t.Fatalf("PromoteVersion(2): %v", err)
+	}
+	if err := p.RollbackVersion(ctx, "app"); err != nil {
+		t.Fatalf("RollbackVersion after a second reload: %v", err)
+	}
+	if cfg, ok := p.appConfig("app"); !ok || cfg.Version != 1 {
+		t.Fatalf("after RollbackVersion, current = %+v, ok=%v", cfg, ok)
+	}
+}
+
+func TestProvider_PromoteVersion_UnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(&fakeStore{}, newFakeClock(time.Now()))
+
+	hist := &appConfigHistory{}
+	hist.add(&model.APIConfig{AppPackageName: "app", Version: 1})
+	p.cache["app"] = hist
+
+	if err := p.PromoteVersion(ctx, "app", 99); err == nil {
+		t.Fatalf("PromoteVersion to an uncached version should have failed")
+	}
+}
+
+func TestDoReload_RefusesTamperedRow(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	good := signedConfig(t, priv, "good-app", 1)
+	bad := signedConfig(t, priv, "bad-app", 1)
+	bad.Signature[0] ^= 0xFF // corrupt after signing
+
+	store := &fakeStore{configs: []*model.APIConfig{good, bad}}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+	p.signingKey = pub
+
+	if err := p.doReload(context.Background()); err != nil {
+		t.Fatalf("doReload: %v", err)
+	}
+
+	if _, ok := p.cache["good-app"]; !ok {
+		t.Fatalf("expected validly signed row to be cached")
+	}
+	if _, ok := p.cache["bad-app"]; ok {
+		t.Fatalf("tampered row should have been refused, not cached")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/lib/pq"
+)
+
+// Watcher observes change notifications for the APIConfig data set. Watch
+// returns a channel that receives a value each time the underlying
+// configuration has changed and a reload should be attempted. The channel
+// is closed when ctx is done or the watcher can no longer observe changes.
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// newWatcher builds a Watcher from the environment, preferring Cloud Pub/Sub
+// when a subscription is configured and falling back to Postgres
+// LISTEN/NOTIFY. It returns a nil Watcher (not an error) when neither is
+// configured, so callers can fall back to periodic refresh only.
+func newWatcher(ctx context.Context) (Watcher, error) {
+	if sub := os.Getenv("CONFIG_WATCHER_PUBSUB_SUBSCRIPTION"); sub != "" {
+		projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+		return NewPubSubWatcher(ctx, projectID, sub)
+	}
+	if dsn := os.Getenv("CONFIG_WATCHER_POSTGRES_DSN"); dsn != "" {
+		return NewPostgresWatcher(dsn), nil
+	}
+	return nil, nil
+}
+
+// PubSubWatcher watches a Cloud Pub/Sub subscription for APIConfig change
+// notifications. Publishers (e.g. the admin console) publish an empty
+// message whenever a row in the APIConfig table is written.
+type PubSubWatcher struct {
+	sub *pubsub.Subscription
+}
+
+// NewPubSubWatcher returns a Watcher backed by the named Pub/Sub
+// subscription in projectID.
+func NewPubSubWatcher(ctx context.Context, projectID, subscriptionID string) (*PubSubWatcher, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("pubsub.NewClient: %w", err)
+	}
+	return &PubSubWatcher{sub: client.Subscription(subscriptionID)}, nil
+}
+
+// Watch implements Watcher.
+func (w *PubSubWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		err := w.sub.Receive(ctx, func(_ context.Context, m *pubsub.Message) {
+			m.Ack()
+			select {
+			case ch <- struct{}{}:
+			default:
+				// A reload is already pending; drop the duplicate signal.
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			// Receive returned on its own, not because ctx was cancelled.
+			// The caller's range over ch will simply stop.
+			return
+		}
+	}()
+	return ch, nil
+}
+
+// PostgresWatcher watches a Postgres LISTEN/NOTIFY channel for APIConfig
+// change notifications. The database trigger that maintains the APIConfig
+// table is expected to issue `NOTIFY apiconfig_changes` on insert/update.
+type PostgresWatcher struct {
+	dsn string
+}
+
+// postgresNotifyChannel is the LISTEN/NOTIFY channel name the APIConfig
+// table trigger publishes to.
+const postgresNotifyChannel = "apiconfig_changes"
+
+// NewPostgresWatcher returns a Watcher backed by Postgres LISTEN/NOTIFY
+// against the given connection string.
+func NewPostgresWatcher(dsn string) *PostgresWatcher {
+	return &PostgresWatcher{dsn: dsn}
+}
+
+// Watch implements Watcher.
+func (w *PostgresWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	reportProblem := func(ev pq.ListenerEventType, err error) {
+		// Errors surface as dropped notifications; the periodic refresh
+		// in provider.go covers us until the listener recovers.
+	}
+	listener := pq.NewListener(w.dsn, 10*time.Second, time.Minute, reportProblem)
+	if err := listener.Listen(postgresNotifyChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("listen %s: %w", postgresNotifyChannel, err)
+	}
+
+	go func() {
+		defer close(ch)
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			case <-time.After(90 * time.Second):
+				// Recommended keepalive from the pq.Listener docs; also
+				// detects a connection that died without notice.
+				go listener.Ping()
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"cambio/pkg/model"
+)
+
+// fakeWatcher lets tests drive Provider.watch's notification handling
+// without a real Pub/Sub subscription or Postgres LISTEN/NOTIFY connection.
+type fakeWatcher struct {
+	ch chan struct{}
+}
+
+func (w *fakeWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	return w.ch, nil
+}
+
+func TestNewWatcher_NoneConfiguredFallsBackToNil(t *testing.T) {
+	for _, key := range []string{"CONFIG_WATCHER_PUBSUB_SUBSCRIPTION", "CONFIG_WATCHER_POSTGRES_DSN"} {
+		old, had := os.LookupEnv(key)
+		os.Unsetenv(key)
+		defer func(key, old string, had bool) {
+			if had {
+				os.Setenv(key, old)
+			}
+		}(key, old, had)
+	}
+
+	w, err := newWatcher(context.Background())
+	if err != nil || w != nil {
+		t.Fatalf("newWatcher() = %v, %v, want nil, nil", w, err)
+	}
+}
+
+func TestProvider_WatchTriggersReloadOnNotify(t *testing.T) {
+	store := &fakeStore{configs: []*model.APIConfig{{AppPackageName: "app", Version: 1}}}
+	p := newTestProvider(store, newFakeClock(time.Now()))
+
+	ch := make(chan struct{}, 1)
+	p.watcher = &fakeWatcher{ch: ch}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.watch(ctx)
+
+	ch <- struct{}{}
+	waitForCallCount(t, store, 1, time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.RLock()
+		needsReload := p.needsReload
+		p.mu.RUnlock()
+		if !needsReload {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("needsReload was never cleared after the triggered reload")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
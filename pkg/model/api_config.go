@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package model holds the data types shared between the database layer
+// and the API handlers.
+package model
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// APIConfig holds the per-application-package configuration that governs
+// how the exposure key upload and export APIs behave for that app.
+type APIConfig struct {
+	AppPackageName string `json:"appPackageName"`
+
+	// AllowedPastKeys, when set, overrides the default validation for how
+	// far in the past an uploaded diagnosis key's rolling period may start.
+	AllowedPastKeys *bool `json:"allowedPastKeys,omitempty"`
+
+	// EncryptedFields holds config values too sensitive to store in the
+	// clear, e.g. HMAC secrets and upload tokens, keyed by field name.
+	EncryptedFields map[string]*EncryptedValue `json:"encryptedFields,omitempty"`
+
+	// Version is a monotonically increasing identifier for this row. Each
+	// write to the APIConfig table increments it, allowing the cache to
+	// keep several versions around for staged rollout and rollback.
+	Version uint64 `json:"version"`
+	// CreatedAt is when this version was written.
+	CreatedAt time.Time `json:"createdAt"`
+	// CreatedBy identifies the admin principal that wrote this version.
+	CreatedBy string `json:"createdBy"`
+
+	// Signature is an Ed25519 signature over Payload(), produced by the
+	// admin console at write time so that a reader can detect a row that
+	// was tampered with in transit or at rest.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// EncryptedValue is an envelope-encrypted config value. Algorithm and KeyID
+// identify which registered decryptor and key to use, so multiple
+// algorithms can coexist in the same table during key rotation.
+type EncryptedValue struct {
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"keyId"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Payload returns the canonical byte representation of the config that is
+// signed and verified. It excludes Signature itself.
+func (c *APIConfig) Payload() ([]byte, error) {
+	cp := *c
+	cp.Signature = nil
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return nil, fmt.Errorf("marshal APIConfig payload: %w", err)
+	}
+	return b, nil
+}
+
+// Sign sets c.Signature to the Ed25519 signature of Payload() under priv.
+func (c *APIConfig) Sign(priv ed25519.PrivateKey) error {
+	payload, err := c.Payload()
+	if err != nil {
+		return err
+	}
+	c.Signature = ed25519.Sign(priv, payload)
+	return nil
+}
+
+// Verify reports whether Signature is a valid Ed25519 signature of
+// Payload() under pub, returning an error describing the failure if not.
+func (c *APIConfig) Verify(pub ed25519.PublicKey) error {
+	if len(c.Signature) == 0 {
+		return fmt.Errorf("APIConfig %s v%d has no signature", c.AppPackageName, c.Version)
+	}
+	payload, err := c.Payload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, payload, c.Signature) {
+		return fmt.Errorf("APIConfig %s v%d: signature verification failed", c.AppPackageName, c.Version)
+	}
+	return nil
+}